@@ -0,0 +1,105 @@
+// This file implements the "grpc" transport on top of two modules not
+// otherwise used by this plugin: google.golang.org/grpc, and the generated
+// huawei-grpc-dialout client/server stub that ships alongside the existing
+// huawei-telemetry sensor types in github.com/DamRCorba/huawei_telemetry_sensors.
+// Both need to be present in go.mod/go.sum for this package to build.
+package huawei_routers_telemetry
+
+import (
+	"net"
+
+	dialout "github.com/DamRCorba/huawei_telemetry_sensors/sensors/huawei-grpc-dialout"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// dialoutServer implements the huawei-grpc-dialout.gRPCDataservice gRPC
+// service: routers configured for gRPC dial-out stream Telemetry messages
+// to dataPublish instead of the plugin polling them.
+type dialoutServer struct {
+	dialout.UnimplementedGRPCDataserviceServer
+
+	*HuaweiRoutersTelemetry
+}
+
+// DataPublish receives a stream of PublishArgs from a dial-out router,
+// decodes each one as a Telemetry message and emits the resulting metrics.
+func (s *dialoutServer) DataPublish(stream dialout.GRPCDataservice_DataPublishServer) error {
+	var sourceIP string
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		sourceIP = peerIP(p.Addr.String())
+	}
+
+	for {
+		args, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		s.stats.recordPacketReceived()
+
+		body, err := s.decoder.Decode([]byte(args.GetMessage()))
+		if err != nil {
+			s.stats.recordDecodeError()
+			s.Log.Errorf("Unable to decode incoming gRPC message: %s", err.Error())
+			continue
+		}
+
+		grouper, err := s.HuaweiTelemetryDecoder(body, sourceIP)
+		if err != nil {
+			s.Log.Errorf("Unable to decode telemetry information: %s", err.Error())
+			continue
+		}
+		for _, m := range grouper.Metrics() {
+			s.AddMetric(m)
+		}
+
+		if err := stream.Send(&dialout.PublishResponse{}); err != nil {
+			return err
+		}
+	}
+}
+
+type grpcListener struct {
+	net.Listener
+	server *grpc.Server
+}
+
+func (l *grpcListener) Close() error {
+	l.server.Stop()
+	return l.Listener.Close()
+}
+
+func (h *HuaweiRoutersTelemetry) startGRPC() error {
+	tlsCfg, err := h.tlsConfig()
+	if err != nil {
+		return err
+	}
+
+	l, err := net.Listen("tcp", ":"+h.ServicePort)
+	if err != nil {
+		return err
+	}
+
+	var opts []grpc.ServerOption
+	if tlsCfg != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsCfg)))
+	}
+
+	server := grpc.NewServer(opts...)
+	dialout.RegisterGRPCDataserviceServer(server, &dialoutServer{HuaweiRoutersTelemetry: h})
+
+	h.Log.Infof("Listening on %s://%s", "grpc", l.Addr())
+
+	h.Closer = &grpcListener{Listener: l, server: server}
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		if err := server.Serve(l); err != nil {
+			h.Log.Errorf("gRPC server stopped: %s", err.Error())
+		}
+	}()
+	return nil
+}
@@ -1,10 +1,16 @@
 package huawei_routers_telemetry
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net"
+	"os"
 	"reflect"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
@@ -14,6 +20,7 @@ import (
 	"github.com/DamRCorba/huawei_telemetry_sensors/sensors/huawei-telemetry"
 
 	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
@@ -31,94 +38,605 @@ type streamSocketListener struct {
 
 	sockType string
 
-	connections    map[string]net.Conn
+	connections    map[string]*trackedConnection
 	connectionsMtx sync.Mutex
 }
 
+// trackedConnection is one live dial-out TCP connection, along with the
+// node/subscription id last seen on it so operators can tell which router
+// and subscription a given peer corresponds to.
+type trackedConnection struct {
+	conn           net.Conn
+	nodeID         string
+	subscriptionID string
+}
+
+// frameLengthBytes is the size, in bytes, of the big-endian length prefix
+// that precedes each Telemetry message on a TCP dial-out connection.
+const frameLengthBytes = 4
+
+// maxFrameLength bounds how large a single TCP dial-out frame is allowed to
+// be, matching the UDP path's 64kb packet buffers. Without this, a bogus or
+// malicious length prefix would make frameLen attacker-controlled up to
+// 4GiB, and that many bytes would be allocated per frame before it's ever
+// validated as a Telemetry message.
+const maxFrameLength = 64 * 1024
+
+func (h *HuaweiRoutersTelemetry) startTCP() error {
+	tlsCfg, err := h.tlsConfig()
+	if err != nil {
+		return err
+	}
+
+	var l net.Listener
+	if tlsCfg != nil {
+		l, err = tls.Listen("tcp", ":"+h.ServicePort, tlsCfg)
+	} else {
+		l, err = net.Listen("tcp", ":"+h.ServicePort)
+	}
+	if err != nil {
+		return err
+	}
+
+	h.Log.Infof("Listening on %s://%s", "tcp", l.Addr())
+
+	ssl := &streamSocketListener{
+		Listener:               l,
+		HuaweiRoutersTelemetry: h,
+		sockType:               "tcp",
+		connections:            make(map[string]*trackedConnection),
+	}
+
+	h.Closer = ssl
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		ssl.listen()
+	}()
+	return nil
+}
+
+// listen accepts dial-out connections from routers and hands each one off
+// to its own read loop so that multiple routers can stream to the same
+// listener concurrently.
+func (l *streamSocketListener) listen() {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			if !strings.Contains(err.Error(), "use of closed network connection") {
+				l.Log.Errorf("Unable to accept connection: %s", err.Error())
+			}
+			break
+		}
+
+		l.connectionsMtx.Lock()
+		l.connections[c.RemoteAddr().String()] = &trackedConnection{conn: c}
+		l.connectionsMtx.Unlock()
+
+		go l.read(c)
+	}
+}
+
+// read frame-decodes length-prefixed Telemetry messages off of a single
+// dial-out connection until it is closed or an unrecoverable error occurs.
+func (l *streamSocketListener) read(c net.Conn) {
+	defer func() {
+		l.connectionsMtx.Lock()
+		delete(l.connections, c.RemoteAddr().String())
+		l.connectionsMtx.Unlock()
+		c.Close()
+	}()
+
+	header := make([]byte, frameLengthBytes)
+	for {
+		if _, err := io.ReadFull(c, header); err != nil {
+			if err != io.EOF {
+				l.Log.Errorf("Unable to read frame length from %s: %s", c.RemoteAddr(), err.Error())
+			}
+			return
+		}
+
+		frameLen := binary.BigEndian.Uint32(header)
+		if frameLen > maxFrameLength {
+			l.Log.Errorf("Frame length %d from %s exceeds the %d byte maximum, closing connection", frameLen, c.RemoteAddr(), maxFrameLength)
+			return
+		}
+		frame := make([]byte, frameLen)
+		if _, err := io.ReadFull(c, frame); err != nil {
+			l.Log.Errorf("Unable to read frame body from %s: %s", c.RemoteAddr(), err.Error())
+			return
+		}
+		l.stats.recordPacketReceived()
+
+		body, err := l.decoder.Decode(frame)
+		if err != nil {
+			l.stats.recordDecodeError()
+			l.Log.Errorf("Unable to decode incoming frame: %s", err.Error())
+			continue
+		}
+
+		grouper, err := l.HuaweiTelemetryDecoder(body, peerIP(c.RemoteAddr().String()))
+		if err != nil {
+			l.Log.Errorf("Unable to decode telemetry information: %s", err.Error())
+			continue
+		}
+		metrics := grouper.Metrics()
+		if len(metrics) > 0 {
+			tags := metrics[0].Tags()
+			l.trackConnection(c, tags["source"], tags["subscription"])
+		}
+		for _, m := range metrics {
+			l.AddMetric(m)
+		}
+	}
+}
+
+// trackConnection records the node/subscription id carried by the latest
+// message read off c, so operators can tell which router and subscription
+// each tracked TCP peer belongs to.
+func (l *streamSocketListener) trackConnection(c net.Conn, nodeID, subscriptionID string) {
+	l.connectionsMtx.Lock()
+	if tc, ok := l.connections[c.RemoteAddr().String()]; ok {
+		tc.nodeID = nodeID
+		tc.subscriptionID = subscriptionID
+	}
+	l.connectionsMtx.Unlock()
+}
+
+func (l *streamSocketListener) Close() error {
+	l.connectionsMtx.Lock()
+	for _, tc := range l.connections {
+		tc.conn.Close()
+	}
+	l.connectionsMtx.Unlock()
+	return l.Listener.Close()
+}
+
+// peerIP strips the port off a "host:port" remote address so it can be
+// recorded as the source_ip tag without port noise fragmenting the series.
+// Addresses that don't parse as host:port are returned unchanged.
+func peerIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// tlsConfig builds a *tls.Config from the configured TLS/mTLS settings. It
+// returns a nil config (and nil error) when no certificate material has
+// been configured, so that TCP and gRPC transports fall back to plaintext.
+func (h *HuaweiRoutersTelemetry) tlsConfig() (*tls.Config, error) {
+	if h.TLSCert == "" && h.TLSKey == "" && h.TLSCA == "" {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{}
+
+	if h.TLSCert != "" || h.TLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(h.TLSCert, h.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading tls_cert/tls_key: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if h.TLSCA != "" {
+		ca, err := os.ReadFile(h.TLSCA)
+		if err != nil {
+			return nil, fmt.Errorf("reading tls_ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("unable to parse tls_ca %q", h.TLSCA)
+		}
+		cfg.ClientCAs = pool
+		cfg.RootCAs = pool
+
+		// This config is only ever used server-side (tls.Listen, or
+		// credentials.NewTLS passed to grpc.Creds), where
+		// InsecureSkipVerify has no effect - it only governs client-side
+		// peer verification. insecure_skip_verify accepts any client
+		// certificate instead, by requiring one without verifying it
+		// against tls_ca.
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		if h.InsecureSkipVerify {
+			cfg.ClientAuth = tls.RequireAnyClientCert
+		}
+	}
+
+	return cfg, nil
+}
+
 type packetSocketListener struct {
 	net.PacketConn
 	*HuaweiRoutersTelemetry
+
+	// jobs fans decoded-ready packets out to the decoder worker pool; a
+	// full channel means the workers can't keep up, so the packet is
+	// dropped (and counted in stats.droppedPackets) rather than blocking
+	// the read loop.
+	jobs    chan []byte
+	bufPool sync.Pool
 }
 
-/*
-  Telemetry Decoder.
+// decodedRow holds one sensor-path row, already flattened to the
+// field/value string pairs that CreateMetrics and AppendTags consume,
+// regardless of which wire encoding it came from.
+type decodedRow struct {
+	timestamp uint64
+	fields    []string
+	vals      []string
+	kinds     []protoreflect.Kind
+}
+
+// telemetryEncodings maps a Telemetry.Encoding value (or the `encoding`
+// config override) to the handler that knows how to pull sensor rows out
+// of that wire format.
+var telemetryEncodings = map[string]func(h *HuaweiRoutersTelemetry, msg *telemetry.Telemetry) []decodedRow{
+	"gpb":     decodeGPBRows,
+	"json":    decodeJSONRows,
+	"gpb-str": decodeGPBStrRows,
+}
+
+// autoEncoding infers the encoding key telemetryEncodings is keyed by from
+// which payload field the message actually populated, rather than from
+// Telemetry.Encoding itself. Huawei's telemetry.proto models encoding as an
+// EncodingType enum, and matching it reliably would mean trusting this
+// tree's guess at that enum's generated constant names; the payload getters
+// below are already depended on by decodeGPBRows/decodeJSONRows/
+// decodeGPBStrRows, so there's nothing left to get wrong here.
+func autoEncoding(msg *telemetry.Telemetry) string {
+	switch {
+	case len(msg.GetDataGpb().GetRow()) > 0:
+		return "gpb"
+	case msg.GetDataJson() != "":
+		return "json"
+	case len(msg.GetDataStr().GetRow()) > 0:
+		return "gpb-str"
+	default:
+		return ""
+	}
+}
+
+// rowTimestamp falls back to the message-level timestamp when a row does
+// not carry its own, matching the original decoder behaviour.
+func rowTimestamp(rowTs, msgTs uint64) uint64 {
+	if rowTs == 0 {
+		return msgTs
+	}
+	return rowTs
+}
+
+// decodeGPBRows handles the compact-GPB encoding: each row's Content is an
+// opaque protobuf blob whose message type is looked up from the
+// YANG-derived sensor-path descriptor.
+func decodeGPBRows(h *HuaweiRoutersTelemetry, msg *telemetry.Telemetry) []decodedRow {
+	rows := msg.GetDataGpb().GetRow()
+	out := make([]decodedRow, 0, len(rows))
+	for _, gpbkv := range rows {
+		sensorMsg := huawei_sensorPath.GetMessageType(msg.GetSensorPath())
+		if err := proto.Unmarshal(gpbkv.Content, sensorMsg); err != nil {
+			h.stats.recordDecodeError()
+			h.Log.Errorf("Unable to unmarshal GPB sensor row for path %q: %s", msg.GetSensorPath(), err.Error())
+			continue
+		}
+		found := SearchKey(sensorMsg, msg.GetSensorPath())
+		fields := make([]string, 0, len(found))
+		vals := make([]string, 0, len(found))
+		kinds := make([]protoreflect.Kind, 0, len(found))
+		for _, fv := range found {
+			fields = append(fields, fv.Path)
+			vals = append(vals, fv.Value)
+			kinds = append(kinds, fv.Kind)
+		}
+		out = append(out, decodedRow{
+			timestamp: rowTimestamp(gpbkv.Timestamp, msg.MsgTimestamp),
+			fields:    fields,
+			vals:      vals,
+			kinds:     kinds,
+		})
+	}
+	return out
+}
+
+// decodeJSONRows handles routers configured to emit DataJson: each row is
+// already a flat JSON object of sensor-field -> value, so no sensor-path
+// descriptor lookup is needed.
+func decodeJSONRows(h *HuaweiRoutersTelemetry, msg *telemetry.Telemetry) []decodedRow {
+	var rows []struct {
+		Timestamp uint64                 `json:"timestamp"`
+		Content   map[string]interface{} `json:"content"`
+	}
+	if err := json.Unmarshal([]byte(msg.GetDataJson()), &rows); err != nil {
+		h.stats.recordDecodeError()
+		h.Log.Errorf("Unable to decode JSON telemetry payload: %s", err.Error())
+		return nil
+	}
+
+	out := make([]decodedRow, 0, len(rows))
+	for _, row := range rows {
+		fields := make([]string, 0, len(row.Content))
+		vals := make([]string, 0, len(row.Content))
+		for k, v := range row.Content {
+			fields = append(fields, k)
+			vals = append(vals, fmt.Sprintf("%v", v))
+		}
+		out = append(out, decodedRow{
+			timestamp: rowTimestamp(row.Timestamp, msg.MsgTimestamp),
+			fields:    fields,
+			vals:      vals,
+			kinds:     make([]protoreflect.Kind, len(fields)),
+		})
+	}
+	return out
+}
+
+// decodeGPBStrRows handles self-describing GPB (DataStr): every field
+// carries its own name and value, so - unlike compact gpb - no sensor-path
+// descriptor is required to interpret it.
+func decodeGPBStrRows(h *HuaweiRoutersTelemetry, msg *telemetry.Telemetry) []decodedRow {
+	rows := msg.GetDataStr().GetRow()
+	out := make([]decodedRow, 0, len(rows))
+	for _, row := range rows {
+		rowFields := row.GetFields()
+		fields := make([]string, 0, len(rowFields))
+		vals := make([]string, 0, len(rowFields))
+		for _, f := range rowFields {
+			fields = append(fields, f.GetName())
+			vals = append(vals, fmt.Sprintf("%v", f.GetValue()))
+		}
+		out = append(out, decodedRow{
+			timestamp: rowTimestamp(row.GetTimestamp(), msg.MsgTimestamp),
+			fields:    fields,
+			vals:      vals,
+			kinds:     make([]protoreflect.Kind, len(fields)),
+		})
+	}
+	return out
+}
+
+// HuaweiTelemetryDecoder unmarshals one Telemetry message off the wire and
+// turns it into a series grouper, dispatching to the handler for the
+// `encoding` config override or, when that is "auto" or unset, for the
+// encoding inferred by autoEncoding (falling back to "gpb").
+// sourceIP, if non-empty, is recorded as the source_ip tag on every emitted
+// metric; UDP callers, which have no per-packet connection to track, pass
+// an empty string and simply omit the tag.
+func (h *HuaweiRoutersTelemetry) HuaweiTelemetryDecoder(body []byte, sourceIP string) (*metric.SeriesGrouper, error) {
+	if n := h.headerBytes(); n > 0 {
+		if len(body) < n {
+			return nil, fmt.Errorf("telemetry packet (%d bytes) shorter than header_bytes (%d)", len(body), n)
+		}
+		body = body[n:]
+	}
 
-*/
-func HuaweiTelemetryDecoder(body []byte) (*metric.SeriesGrouper, error) {
 	msg := &telemetry.Telemetry{}
-	err := proto.Unmarshal(body[12:], msg)
+	err := proto.Unmarshal(body, msg)
 	if err != nil {
-		fmt.Println("Unable to decode incoming packet: ", err.Error())
-		return nil, err		
+		h.stats.recordUnmarshalError()
+		h.Log.Errorf("Unable to decode incoming packet: %s", err.Error())
+		return nil, err
+	}
+
+	// Filtered paths are dropped before the per-row gpbkv.Content is ever
+	// unmarshaled, so they cost close to nothing.
+	if !h.pathAllowed(msg.GetSensorPath()) {
+		return metric.NewSeriesGrouper(), nil
+	}
+
+	encoding := h.Encoding
+	if encoding == "" || encoding == "auto" {
+		encoding = autoEncoding(msg)
+	}
+	if encoding == "" {
+		encoding = "gpb"
+	}
+
+	handler, ok := telemetryEncodings[encoding]
+	if !ok {
+		return nil, fmt.Errorf("unsupported telemetry encoding %q", encoding)
 	}
+
+	rows := handler(h, msg)
+
 	grouper := metric.NewSeriesGrouper()
-	for _, gpbkv := range msg.GetDataGpb().GetRow() {
-		dataTime := gpbkv.Timestamp
-		if dataTime == 0 {
-			dataTime = msg.MsgTimestamp
-		}
-		timestamp := time.Unix(int64(dataTime/1000), int64(dataTime%1000)*1000000)
-		sensorMsg := huawei_sensorPath.GetMessageType(msg.GetSensorPath())
-		err = proto.Unmarshal(gpbkv.Content, sensorMsg)
-		if err != nil {
-			fmt.Println("Sensor Error: ", err.Error())
-			return nil, err
-		}
-		fields, vals := huawei_sensorPath.SearchKey(gpbkv, msg.GetSensorPath())
-		tags := make(map[string]string, len(fields)+3)
+	for _, row := range rows {
+		timestamp := time.Unix(int64(row.timestamp/1000), int64(row.timestamp%1000)*1000000)
+		tags := make(map[string]string, len(row.fields)+3)
 		tags["source"] = msg.GetNodeIdStr()
 		tags["subscription"] = msg.GetSubscriptionIdStr()
 		tags["path"] = msg.GetSensorPath()
+		if sourceIP != "" {
+			tags["source_ip"] = sourceIP
+		}
 		// Search for Tags
-		for i := 0; i < len(fields); i++ {
-			tags = huawei_sensorPath.AppendTags(fields[i], vals[i], tags, msg.GetSensorPath())
+		for i := 0; i < len(row.fields); i++ {
+			tags = h.AppendTags(row.fields[i], row.vals[i], tags, msg.GetSensorPath(), row.kinds[i])
 		}
 		// Create Metrics
-		for i := 0; i < len(fields); i++ {
-			CreateMetrics(grouper, tags, timestamp, msg.GetSensorPath(), fields[i], vals[i])
+		for i := 0; i < len(row.fields); i++ {
+			h.CreateMetrics(grouper, tags, timestamp, msg.GetSensorPath(), row.fields[i], row.vals[i], row.kinds[i])
 		}
 	}
+
+	h.stats.recordRows(msg.GetNodeIdStr(), msg.GetSubscriptionIdStr(), len(rows))
+
 	return grouper, nil
 }
 
+// pathAllowed reports whether rows for the given sensor path should be
+// decoded: sensor_paths_include, if set, is an allow-list, and
+// sensor_paths_exclude always wins over it.
+func (h *HuaweiRoutersTelemetry) pathAllowed(path string) bool {
+	if len(h.SensorPathsInclude) > 0 && !containsPath(h.SensorPathsInclude, path) {
+		return false
+	}
+	return !containsPath(h.SensorPathsExclude, path)
+}
+
+func containsPath(paths []string, path string) bool {
+	for _, p := range paths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// headerBytes returns the number of leading bytes to strip from each
+// packet before protobuf-decoding it, defaulting to the 12-byte Huawei
+// header when `header_bytes` has not been set.
+func (h *HuaweiRoutersTelemetry) headerBytes() int {
+	if h.HeaderBytes != nil {
+		return *h.HeaderBytes
+	}
+	return 12
+}
+
+// decoderWorkers returns the configured size of the decode worker pool,
+// defaulting to runtime.NumCPU() when decoder_workers is unset.
+func (h *HuaweiRoutersTelemetry) decoderWorkers() int {
+	if h.DecoderWorkers > 0 {
+		return h.DecoderWorkers
+	}
+	return runtime.NumCPU()
+}
+
+// queueLength reports how many packets are currently queued for decoding,
+// so operators can tell whether decoder_workers needs to be raised.
+func (h *packetSocketListener) queueLength() int {
+	return len(h.jobs)
+}
+
 /*
-  Listen UDP packets and call the telemetryDecoder.
+  Listen UDP packets and fan them out to a pool of decoder workers.
 */
 func (h *packetSocketListener) listen() {
-	buf := make([]byte, 64*1024) // 64kb - maximum size of IP packet
+	h.bufPool.New = func() interface{} {
+		return make([]byte, 64*1024) // 64kb - maximum size of IP packet
+	}
+	h.jobs = make(chan []byte, h.decoderWorkers()*4)
+
+	var workers sync.WaitGroup
+	for i := 0; i < h.decoderWorkers(); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			h.decodeLoop()
+		}()
+	}
+
 	for {
+		buf := h.bufPool.Get().([]byte)
 		n, _, err := h.ReadFrom(buf)
 		if err != nil {
 			h.Log.Error("Unable to read buffer: %s", err.Error())
+			h.bufPool.Put(buf) //nolint:staticcheck // buf is still at full capacity
 			break
 		}
 
-		body, err := h.decoder.Decode(buf[:n])
-		if err != nil {
-			h.Log.Errorf("Unable to decode incoming packet: %s", err.Error())
-			continue
-		}
-		// Telemetry parsing over packet payload
-		grouper, err := HuaweiTelemetryDecoder(body)
-		if err != nil {
-			h.Log.Errorf("Unable to decode telemetry information: %s", err.Error())
-			break
-		}
-		for _, metric := range grouper.Metrics() {
-			h.AddMetric(metric)
-		}
+		h.stats.recordPacketReceived()
 
-		if err != nil {
-			h.Log.Errorf("Unable to parse incoming packet: %s", err.Error())
+		select {
+		case h.jobs <- buf[:n]:
+		default:
+			dropped := h.stats.recordDroppedPacket()
+			h.Log.Warnf("Decoder queue full, dropping packet (%d dropped so far)", dropped)
+			h.bufPool.Put(buf[:cap(buf)])
 		}
 	}
+
+	close(h.jobs)
+	workers.Wait()
+}
+
+// decodeLoop pulls queued packets off h.jobs, decodes them and emits the
+// resulting metrics, returning each buffer to the pool once it's done.
+func (h *packetSocketListener) decodeLoop() {
+	for buf := range h.jobs {
+		h.decodeAndEmit(buf)
+		h.bufPool.Put(buf[:cap(buf)])
+	}
+}
+
+func (h *packetSocketListener) decodeAndEmit(packet []byte) {
+	body, err := h.decoder.Decode(packet)
+	if err != nil {
+		h.stats.recordDecodeError()
+		h.Log.Errorf("Unable to decode incoming packet: %s", err.Error())
+		return
+	}
+	// Telemetry parsing over packet payload
+	grouper, err := h.HuaweiTelemetryDecoder(body, "")
+	if err != nil {
+		h.Log.Errorf("Unable to decode telemetry information: %s", err.Error())
+		return
+	}
+	for _, metric := range grouper.Metrics() {
+		h.AddMetric(metric)
+	}
 }
 
 type HuaweiRoutersTelemetry struct {
 	ServicePort     string        `toml:"service_port"`
 	ReadBufferSize  internal.Size `toml:"read_buffer_size"`
 	ContentEncoding string        `toml:"content_encoding"`
-	wg              sync.WaitGroup
+
+	// Transport selects how the router delivers telemetry: "udp" (default),
+	// "tcp" or "grpc" dial-out.
+	Transport string `toml:"transport"`
+
+	TLSCert string `toml:"tls_cert"`
+	TLSKey  string `toml:"tls_key"`
+	TLSCA   string `toml:"tls_ca"`
+
+	// InsecureSkipVerify relaxes mTLS (tls_ca) from requiring and
+	// verifying the dial-out router's client certificate to merely
+	// requiring one, without verifying it against tls_ca. It has no
+	// effect when tls_ca isn't set.
+	InsecureSkipVerify bool `toml:"insecure_skip_verify"`
+
+	// Encoding selects how to interpret the Telemetry payload: "auto"
+	// (default, inferred from which payload field the message populates;
+	// its Encoding field is not consulted), "gpb", "json" or "gpb-str"
+	// (self-describing GPB).
+	Encoding string `toml:"encoding"`
+
+	// HeaderBytes is the number of leading bytes to strip from every
+	// packet before protobuf-decoding it. Defaults to 12 (the Huawei
+	// dial-out header) when left unset; set to 0 for deployments that
+	// don't prepend it.
+	HeaderBytes *int `toml:"header_bytes"`
+
+	// DecoderWorkers sizes the pool of goroutines decoding queued
+	// packets in parallel. Defaults to runtime.NumCPU() when unset.
+	DecoderWorkers int `toml:"decoder_workers"`
+
+	// SensorPathsInclude, if non-empty, is the only set of sensor paths
+	// that will be decoded; everything else is dropped before the
+	// per-row protobuf content is ever unmarshaled.
+	SensorPathsInclude []string `toml:"sensor_paths_include"`
+	// SensorPathsExclude is dropped even if also matched by
+	// SensorPathsInclude.
+	SensorPathsExclude []string `toml:"sensor_paths_exclude"`
+
+	// Rename maps a (sensor_path, field) pair to the measurement and/or
+	// field name it should be recorded under.
+	Rename []renameMapping `toml:"rename"`
+
+	// Enums extends/overrides the built-in enum-to-integer mappings
+	// (see defaultEnums) with additional fields.
+	Enums     []enumMapping `toml:"enum"`
+	enumTable map[string]map[string]int64
+
+	wg    sync.WaitGroup
+	stats *stats
+
+	// udpListener is set by startUDP so Gather can read the decoder
+	// queue's current length; it is nil for the tcp/grpc transports,
+	// which have no comparable queue.
+	udpListener *packetSocketListener
 
 	Log telegraf.Logger `toml:"-"`
 
@@ -136,15 +654,69 @@ func (h *HuaweiRoutersTelemetry) SampleConfig() string {
   ## UDP Service Port to capture Telemetry
   # service_port = "8080"
 
+  ## Transport used to receive telemetry from the router: "udp" (default),
+  ## "tcp" or "grpc" dial-out.
+  # transport = "udp"
+
+  ## TLS/mTLS settings, used when transport is "tcp" or "grpc".
+  # tls_cert = "/etc/telegraf/cert.pem"
+  # tls_key = "/etc/telegraf/key.pem"
+  # tls_ca = "/etc/telegraf/ca.pem"
+
+  ## With tls_ca set, require a client certificate from the dial-out
+  ## router without verifying it against tls_ca.
+  # insecure_skip_verify = false
+
+  ## Wire encoding of the Telemetry payload: "auto" (default, taken from
+  ## the message itself), "gpb", "json" or "gpb-str".
+  # encoding = "auto"
+
+  ## Number of leading bytes to strip from every packet before decoding
+  ## it. Defaults to 12 (the Huawei dial-out header) when unset.
+  # header_bytes = 12
+
+  ## Number of goroutines decoding queued packets in parallel. Defaults
+  ## to the number of available CPUs.
+  # decoder_workers = 4
+
+  ## Only decode rows for these sensor paths; everything else is dropped
+  ## before its protobuf content is ever unmarshaled. Leave unset to
+  ## decode every path not excluded below.
+  # sensor_paths_include = ["huawei-ifm:ifm/interfaces/interface"]
+
+  ## Never decode rows for these sensor paths, even if also matched by
+  ## sensor_paths_include.
+  # sensor_paths_exclude = []
+
+  ## Rename the measurement and/or field a sensor-path field is recorded
+  ## under.
+  # [[inputs.huawei_routers_telemetry.rename]]
+  #   sensor_path = "huawei-ifm:ifm/interfaces/interface"
+  #   field = "ifName"
+  #   measurement = "interface"
+  #   name = "name"
+
+  ## Extend or override the built-in enum-to-integer mappings (only
+  ## ifAdminStatus/ifOperStatus ship by default).
+  # [[inputs.huawei_routers_telemetry.enum]]
+  #   field = "ifAdminStatus"
+  #   values = { IfAdminStatus_UP = 1, IfAdminStatus_DOWN = 0 }
+
 `
 }
 
-func (h *HuaweiRoutersTelemetry) Gather(_ telegraf.Accumulator) error {
+func (h *HuaweiRoutersTelemetry) Gather(acc telegraf.Accumulator) error {
+	if h.udpListener != nil {
+		h.stats.recordQueueLength(h.udpListener.queueLength())
+	}
+	h.stats.report(acc)
 	return nil
 }
 
 func (h *HuaweiRoutersTelemetry) Start(acc telegraf.Accumulator) error {
 	h.Accumulator = acc
+	h.stats = newStats()
+	h.buildEnums()
 
 	var err error
 	h.decoder, err = internal.NewContentDecoder(h.ContentEncoding)
@@ -152,6 +724,30 @@ func (h *HuaweiRoutersTelemetry) Start(acc telegraf.Accumulator) error {
 		return err
 	}
 
+	h.wg = sync.WaitGroup{}
+
+	switch h.transport() {
+	case "udp":
+		return h.startUDP()
+	case "tcp":
+		return h.startTCP()
+	case "grpc":
+		return h.startGRPC()
+	default:
+		return fmt.Errorf("unsupported transport %q: must be one of \"udp\", \"tcp\" or \"grpc\"", h.Transport)
+	}
+}
+
+// transport returns the configured transport, defaulting to "udp" for
+// backwards compatibility with existing configurations.
+func (h *HuaweiRoutersTelemetry) transport() string {
+	if h.Transport == "" {
+		return "udp"
+	}
+	return h.Transport
+}
+
+func (h *HuaweiRoutersTelemetry) startUDP() error {
 	pc, err := udpListen("udp", ":"+h.ServicePort)
 	if err != nil {
 		return err
@@ -173,7 +769,7 @@ func (h *HuaweiRoutersTelemetry) Start(acc telegraf.Accumulator) error {
 	}
 
 	h.Closer = psl
-	h.wg = sync.WaitGroup{}
+	h.udpListener = psl
 	h.wg.Add(1)
 	go func() {
 		defer h.wg.Done()
@@ -182,6 +778,86 @@ func (h *HuaweiRoutersTelemetry) Start(acc telegraf.Accumulator) error {
 	return nil
 }
 
+// defaultEnums are the built-in enum-to-integer mappings, covering the
+// interface admin/oper status fields that used to be a hardcoded pair of
+// if/else checks. User-supplied `enum` tables are merged on top of these,
+// so a field can be overridden or new ones added without touching code.
+var defaultEnums = map[string]map[string]int64{
+	"ifAdminStatus": {"IfAdminStatus_UP": 1},
+	"ifOperStatus":  {"IfOperStatus_UP": 1},
+}
+
+// renameMapping is one `[[inputs.huawei_routers_telemetry.rename]]` table,
+// renaming the measurement and/or field that a single sensor-path field
+// is recorded under. Either Measurement or Name may be left blank to
+// leave that half unchanged.
+type renameMapping struct {
+	SensorPath  string `toml:"sensor_path"`
+	Field       string `toml:"field"`
+	Measurement string `toml:"measurement"`
+	Name        string `toml:"name"`
+}
+
+// enumMapping is one `[[inputs.huawei_routers_telemetry.enum]]` table,
+// mapping a field's string enum values to the integer telegraf should
+// record for it. Any value not listed is recorded as 0.
+type enumMapping struct {
+	Field  string           `toml:"field"`
+	Values map[string]int64 `toml:"values"`
+}
+
+// buildEnums merges the built-in and user-configured enum mappings into
+// h.enumTable. It is called once from Start, before any decode goroutine
+// can be running, because enumValue (called from every UDP worker, TCP
+// connection and gRPC stream goroutine) reads h.enumTable without a lock -
+// building it lazily from those hot paths raced on first use.
+func (h *HuaweiRoutersTelemetry) buildEnums() {
+	table := make(map[string]map[string]int64, len(defaultEnums)+len(h.Enums))
+	for field, values := range defaultEnums {
+		table[field] = values
+	}
+	for _, e := range h.Enums {
+		table[e.Field] = e.Values
+	}
+	h.enumTable = table
+}
+
+// enums returns the merged table of built-in and user-configured enum
+// mappings built by buildEnums.
+func (h *HuaweiRoutersTelemetry) enums() map[string]map[string]int64 {
+	return h.enumTable
+}
+
+// enumValue looks val up in the enum mapping configured for field. The
+// second return reports whether field is an enum at all, so the caller
+// can fall back to decodeVal for everything else.
+func (h *HuaweiRoutersTelemetry) enumValue(field, val string) (int64, bool) {
+	mapping, ok := h.enums()[field]
+	if !ok {
+		return 0, false
+	}
+	return mapping[val], true
+}
+
+// renameField applies the first matching `[[inputs.huawei_routers_telemetry.rename]]`
+// entry for (path, field), letting operators rename either the measurement
+// or the field it's recorded under, or both.
+func (h *HuaweiRoutersTelemetry) renameField(path, field string) (measurement, name string) {
+	for _, r := range h.Rename {
+		if r.SensorPath != path || r.Field != field {
+			continue
+		}
+		if r.Measurement != "" {
+			path = r.Measurement
+		}
+		if r.Name != "" {
+			field = r.Name
+		}
+		break
+	}
+	return path, field
+}
+
 /*
   Creates and add metrics from json mapped data in telegraf metrics SeriesGrouper
   @params:
@@ -193,28 +869,51 @@ func (h *HuaweiRoutersTelemetry) Start(acc telegraf.Accumulator) error {
     vals (string) - subkey content
 
 */
-func CreateMetrics(grouper *metric.SeriesGrouper, tags map[string]string, timestamp time.Time, path string, subfield string, vals string)  {
-  if subfield == "ifAdminStatus" {
+func (h *HuaweiRoutersTelemetry) CreateMetrics(grouper *metric.SeriesGrouper, tags map[string]string, timestamp time.Time, path string, subfield string, vals string, kind protoreflect.Kind)  {
+  if v, ok := h.enumValue(subfield, vals); ok {
     name:= strings.Replace(subfield,"\"","",-1)
-    if vals == "IfAdminStatus_UP" {
-      grouper.Add(path, tags, timestamp, string(name), 1)
-    } else {
-      grouper.Add(path, tags, timestamp, string(name), 0)
-    }
-  }
-  if subfield == "ifOperStatus" {
-    name:= strings.Replace(subfield,"\"","",-1)
-    if vals == "IfOperStatus_UP" {
-      grouper.Add(path, tags, timestamp, string(name), 1)
-    } else {
-      grouper.Add(path, tags, timestamp, string(name), 0)
-    }
+    measurement, field := h.renameField(path, name)
+    grouper.Add(measurement, tags, timestamp, field, v)
+    return
   }
   if vals != "" && subfield != "ifName" && subfield != "position" && subfield != "pemIndex" && subfield != "address" && subfield != "i2c" && subfield != "channel" &&
-  subfield != "queueType" && subfield != "ifAdminStatus" && subfield != "ifOperStatus" {
+  subfield != "queueType" {
     name:= strings.Replace(subfield,"\"","",-1)
-    endPointTypes:=GetTypeValue(path)
-    grouper.Add(path, tags, timestamp, string(name), decodeVal(endPointTypes[name], vals))
+    measurement, field := h.renameField(path, name)
+    grouper.Add(measurement, tags, timestamp, field, typedValue(kind, path, name, vals))
+  }
+}
+
+// typedValue converts vals using the protobuf field Kind SearchKey carried
+// alongside it, so compact-GPB rows no longer need the decodeVal
+// string-parse-and-reparse round trip. Kind is the zero value for
+// descriptor-less sensors (e.g. JSON/self-describing rows), in which case
+// the legacy GetTypeValue/decodeVal table is used as a fallback.
+func typedValue(kind protoreflect.Kind, path string, name string, vals string) interface{} {
+  switch kind {
+  case protoreflect.BoolKind:
+    v, _ := strconv.ParseBool(vals)
+    return v
+  case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+    v, _ := strconv.ParseInt(vals, 10, 32)
+    return v
+  case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+    v, _ := strconv.ParseInt(vals, 10, 64)
+    return v
+  case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+    v, _ := strconv.ParseUint(vals, 10, 32)
+    return v
+  case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+    v, _ := strconv.ParseUint(vals, 10, 64)
+    return v
+  case protoreflect.FloatKind, protoreflect.DoubleKind:
+    v, _ := strconv.ParseFloat(vals, 64)
+    return v
+  case protoreflect.StringKind, protoreflect.EnumKind, protoreflect.BytesKind:
+    return vals
+  default:
+    endPointTypes := GetTypeValue(path)
+    return decodeVal(endPointTypes[name], vals)
   }
 }
 
@@ -225,26 +924,33 @@ func CreateMetrics(grouper *metric.SeriesGrouper, tags map[string]string, timest
   v - Content of the Key
   tags - Global tags of the metric
   path - Telemetry path
+  kind - protobuf Kind of the field, or its zero value for descriptor-less
+         sensors
   @returns
   original tag append the key if its a name Key.
 
 */
-func AppendTags(k string, v string, tags map[string]string, path string) map[string]string {
-  resolve := tags
+func (h *HuaweiRoutersTelemetry) AppendTags(k string, v string, tags map[string]string, path string, kind protoreflect.Kind) map[string]string {
+  if kind != 0 {
+    if (kind == protoreflect.StringKind || kind == protoreflect.EnumKind) && k != "ifAdminStatus" {
+      tags[k] = v
+    }
+    return tags
+  }
   endPointTypes:=GetTypeValue(path)
   if endPointTypes[k] != nil {
     if reflect.TypeOf(decodeVal(endPointTypes[k], v)) == reflect.TypeOf("") {
       if k != "ifAdminStatus" {
-          resolve[k] = v
+          tags[k] = v
       }
     }
   } else {
     if k == "ifName" || k == "position" || k == "pemIndex" || k == "i2c"{
-      resolve[k] = v
+      tags[k] = v
     }
 
   }
-  return resolve
+  return tags
 }
 
 /*
@@ -277,91 +983,88 @@ func decodeVal(tipo interface{}, val string) interface{} {
   return resolve;
 }
 
-/*
-  Search de keys and vals of the data row in telemetry message.
-  @params:
-  - Message (*TelemetryRowGPB) - data buffer GPB of sensor data
-  - sensorType (string) - sensor-path group.
-  @returns:
-  - keys (string) - Keys of the fields
-  - vals (string) - Vals of the fields
-*/
-func SearchKey(Message *telemetry.TelemetryRowGPB, path string)  ([]string, []string){
-  sensorType := strings.Split(path,":")[0]
-  sensorMsg := GetMessageType(sensorType)
-  err := proto.Unmarshal(Message.Content, sensorMsg)
-  if (err != nil) {
-    panic(err)
-  }
-  primero := reflect.ValueOf(sensorMsg).Interface()
-
-  str := fmt.Sprintf("%v", primero)
-  // format string to JsonString with some modifications.
-  jsonString := strings.Replace(str,"<>", "0",-1)
-  jsonString = strings.Replace(jsonString,"<", "{\"",-1)
-  jsonString= strings.Replace(jsonString,">", "\"}",-1)
-  jsonString= strings.Replace(jsonString," ", ",\"",-1)
-  jsonString= strings.Replace(jsonString,":", "\":",-1)
-  jsonString= strings.Replace(jsonString,",\"\"","",-1)
-  jsonString= strings.Replace(jsonString,"},\"", "}",-1)
-  jsonString= strings.Replace(jsonString,","," ",-1)
-  jsonString= strings.Replace(jsonString,"{"," ",-1)
-  jsonString= strings.Replace(jsonString,"}","",-1)
-  jsonString="\""+jsonString
-  if path == "huawei-ifm:ifm/interfaces/interface/ifDynamicInfo" { // Particular case.....
-    jsonString= strings.Replace(jsonString,"IfOperStatus_UPifName\"","IfOperStatus_UP \"ifName\"",-1)
-  }
-  lastQuote := rune(0)
-      f := func(c rune) bool {
-          switch {
-          case c == lastQuote:
-              lastQuote = rune(0)
-              return false
-          case lastQuote != rune(0):
-              return false
-          case unicode.In(c, unicode.Quotation_Mark):
-              lastQuote = c
-              return false
-          default:
-              return unicode.IsSpace(c)
-
-          }
-      }
+// fieldValue is one field pulled out of a sensor message by SearchKey,
+// carrying its protobuf Kind so callers can convert Value without
+// guessing its type from a descriptor table.
+type fieldValue struct {
+	Path  string
+	Value string
+	Kind  protoreflect.Kind
+}
 
-    // splitting string by space but considering quoted section
-    items := strings.FieldsFunc(jsonString, f)
+// impliedEnumDefaults carries the same "Huawei bad struct data" knowledge
+// the original string-scraping SearchKey special-cased: these enum fields
+// are only put on the wire when they're non-zero, so protoreflect.Range
+// (which only visits populated fields) silently omits them while the
+// interface is down. Without synthesizing the zero value here, a DOWN
+// interface would simply stop reporting ifAdminStatus/ifOperStatus
+// instead of reporting it as down.
+var impliedEnumDefaults = map[string]map[string]string{
+	"huawei-ifm:ifm/interfaces/interface":               {"ifAdminStatus": "IfAdminStatus_DOWN"},
+	"huawei-ifm:ifm/interfaces/interface/ifDynamicInfo": {"ifOperStatus": "IfOperStatus_DOWN"},
+}
 
-    // create and fill the map
-    m := make(map[string]string)
-    for _, item := range items {
-        x := strings.Split(item, ":")
-        m[x[0]] = x[1]
-    }
-    // get keys and vals of fields
-    var keys []string
-    var vals []string
-    for k, v := range m {
-        name:= strings.Replace(k,"\"","",-1) // remove quotes
-        keys = append(keys, name)
-        vals = append(vals, v)
+// SearchKey walks an already-unmarshaled sensor message with
+// protoreflect.Message.Range and flattens it into (name, value) pairs,
+// recursing into nested messages and expanding repeated fields along the
+// way. This replaces the previous implementation, which formatted the
+// message with fmt.Sprintf("%v", ...) and reparsed the result as
+// pseudo-JSON - fragile (it needed a hardcoded special case for
+// IfOperStatus_UPifName), slow, and silently dropping anything but flat
+// scalar fields.
+func SearchKey(sensorMsg proto.Message, path string) []fieldValue {
+	found := searchFields(proto.MessageReflect(sensorMsg))
+	for field, defaultVal := range impliedEnumDefaults[path] {
+		present := false
+		for _, fv := range found {
+			if fv.Path == field {
+				present = true
+				break
+			}
+		}
+		if !present {
+			found = append(found, fieldValue{Path: field, Value: defaultVal, Kind: protoreflect.EnumKind})
+		}
+	}
+	return found
+}
 
-    }
-    // Adaptation to resolve Huawei bad struct Data.
-    if path == "huawei-ifm:ifm/interfaces/interface" {
-      if Find(keys, "ifAdminStatus") == -1 {
-        keys = append(keys, "ifAdminStatus")
-        vals = append(vals, "IfAdminStatus_DOWN")
-      }
-    }
-    // Adaptation to resolve Huawei bad struct Data.
-    if path == "huawei-ifm:ifm/interfaces/interface/ifDynamicInfo" {
-      if Find(keys, "ifOperStatus") == -1 {
-        keys = append(keys, "ifOperStatus")
-        vals = append(vals, "IfOperStatus_DOWN")
-      }
-    }
+func searchFields(m protoreflect.Message) []fieldValue {
+	var out []fieldValue
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		out = append(out, fieldValues(fd, v)...)
+		return true
+	})
+	return out
+}
+
+func fieldValues(fd protoreflect.FieldDescriptor, v protoreflect.Value) []fieldValue {
+	if fd.IsList() {
+		list := v.List()
+		out := make([]fieldValue, 0, list.Len())
+		for i := 0; i < list.Len(); i++ {
+			out = append(out, fieldValue1(fd, list.Get(i))...)
+		}
+		return out
+	}
+	return fieldValue1(fd, v)
+}
+
+func fieldValue1(fd protoreflect.FieldDescriptor, v protoreflect.Value) []fieldValue {
+	name := string(fd.Name())
 
-  return keys, vals
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return searchFields(v.Message())
+	case protoreflect.EnumKind:
+		value := strconv.FormatInt(int64(v.Enum()), 10)
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			value = string(ev.Name())
+		}
+		return []fieldValue{{Path: name, Value: value, Kind: fd.Kind()}}
+	default:
+		return []fieldValue{{Path: name, Value: fmt.Sprintf("%v", v.Interface()), Kind: fd.Kind()}}
+	}
 }
 
 
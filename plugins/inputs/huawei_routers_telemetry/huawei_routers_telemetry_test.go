@@ -0,0 +1,141 @@
+package huawei_routers_telemetry
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestContainsPath(t *testing.T) {
+	paths := []string{"a", "b"}
+	if !containsPath(paths, "a") {
+		t.Error("expected \"a\" to be contained")
+	}
+	if containsPath(paths, "c") {
+		t.Error("did not expect \"c\" to be contained")
+	}
+}
+
+func TestPathAllowed(t *testing.T) {
+	cases := []struct {
+		name    string
+		include []string
+		exclude []string
+		path    string
+		want    bool
+	}{
+		{"no filters configured", nil, nil, "any/path", true},
+		{"include matches", []string{"a/b"}, nil, "a/b", true},
+		{"include does not match", []string{"a/b"}, nil, "c/d", false},
+		{"exclude wins over include", []string{"a/b"}, []string{"a/b"}, "a/b", false},
+		{"exclude only", nil, []string{"a/b"}, "a/b", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h := &HuaweiRoutersTelemetry{SensorPathsInclude: c.include, SensorPathsExclude: c.exclude}
+			if got := h.pathAllowed(c.path); got != c.want {
+				t.Errorf("pathAllowed(%q) = %v, want %v", c.path, got, c.want)
+			}
+		})
+	}
+}
+
+func TestRenameField(t *testing.T) {
+	h := &HuaweiRoutersTelemetry{
+		Rename: []renameMapping{
+			{SensorPath: "huawei-ifm:ifm/interfaces/interface", Field: "ifName", Measurement: "interface", Name: "name"},
+			{SensorPath: "huawei-ifm:ifm/interfaces/interface", Field: "ifAdminStatus", Name: "admin_status"},
+		},
+	}
+
+	if measurement, field := h.renameField("huawei-ifm:ifm/interfaces/interface", "ifName"); measurement != "interface" || field != "name" {
+		t.Errorf("got (%q, %q), want (\"interface\", \"name\")", measurement, field)
+	}
+
+	if measurement, field := h.renameField("huawei-ifm:ifm/interfaces/interface", "ifAdminStatus"); measurement != "huawei-ifm:ifm/interfaces/interface" || field != "admin_status" {
+		t.Errorf("got (%q, %q), want measurement unchanged and field renamed", measurement, field)
+	}
+
+	if measurement, field := h.renameField("huawei-ifm:ifm/interfaces/interface", "unmapped"); measurement != "huawei-ifm:ifm/interfaces/interface" || field != "unmapped" {
+		t.Errorf("expected an unmapped field to pass through unchanged, got (%q, %q)", measurement, field)
+	}
+}
+
+func TestEnumValue(t *testing.T) {
+	h := &HuaweiRoutersTelemetry{
+		Enums: []enumMapping{
+			{Field: "ifAdminStatus", Values: map[string]int64{"IfAdminStatus_UP": 1, "IfAdminStatus_DOWN": 0}},
+		},
+	}
+	h.buildEnums()
+
+	if v, ok := h.enumValue("ifAdminStatus", "IfAdminStatus_UP"); !ok || v != 1 {
+		t.Errorf("got (%v, %v), want (1, true)", v, ok)
+	}
+
+	if _, ok := h.enumValue("ifName", "Ethernet0"); ok {
+		t.Error("ifName should not resolve as an enum field")
+	}
+
+	// defaultEnums still applies on a plugin instance that hasn't
+	// overridden it via the `enum` config table.
+	fresh := &HuaweiRoutersTelemetry{}
+	fresh.buildEnums()
+	if v, ok := fresh.enumValue("ifOperStatus", "IfOperStatus_UP"); !ok || v != 1 {
+		t.Errorf("got (%v, %v), want (1, true) from defaultEnums", v, ok)
+	}
+}
+
+// TestSearchFieldsWalksNestedAndRepeatedFields exercises searchFields and
+// fieldValues against a real protoreflect.Message rather than a sensor
+// type, since the generated Huawei sensor messages aren't vendored into
+// this tree. descriptorpb.DescriptorProto is a convenient stand-in: its
+// repeated Field is a MessageKind list, and each FieldDescriptorProto
+// inside it has both a StringKind field (Name) and an EnumKind field
+// (Type), covering repeated-field expansion, message recursion and enum
+// name resolution in one shape.
+func TestSearchFieldsWalksNestedAndRepeatedFields(t *testing.T) {
+	msg := &descriptorpb.DescriptorProto{
+		Field: []*descriptorpb.FieldDescriptorProto{
+			{
+				Name: proto.String("ifName"),
+				Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+			},
+			{
+				Name: proto.String("ifIndex"),
+				Type: descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum(),
+			},
+		},
+	}
+
+	found := searchFields(msg.ProtoReflect())
+
+	byPath := map[string][]fieldValue{}
+	for _, fv := range found {
+		byPath[fv.Path] = append(byPath[fv.Path], fv)
+	}
+
+	names := byPath["name"]
+	if len(names) != 2 {
+		t.Fatalf("expected 2 nested \"name\" values from the repeated field, got %d", len(names))
+	}
+	if names[0].Kind != protoreflect.StringKind {
+		t.Errorf("name field Kind = %v, want StringKind", names[0].Kind)
+	}
+
+	types := byPath["type"]
+	if len(types) != 2 {
+		t.Fatalf("expected 2 nested \"type\" values, got %d", len(types))
+	}
+	if types[0].Kind != protoreflect.EnumKind {
+		t.Errorf("type field Kind = %v, want EnumKind", types[0].Kind)
+	}
+	if types[0].Value != "TYPE_STRING" {
+		t.Errorf("type field Value = %q, want %q", types[0].Value, "TYPE_STRING")
+	}
+	if types[1].Value != "TYPE_INT32" {
+		t.Errorf("type field Value = %q, want %q", types[1].Value, "TYPE_INT32")
+	}
+}
@@ -0,0 +1,134 @@
+package huawei_routers_telemetry
+
+import (
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// subscriptionStats tracks the last time a given node/subscription pair
+// delivered a row and how many it has delivered since the last Gather,
+// so operators can detect a dial-out subscription going silent without
+// needing to sniff the wire.
+type subscriptionStats struct {
+	source       string
+	subscription string
+	lastSeen     time.Time
+	lastReport   time.Time
+	rows         uint64
+}
+
+// stats is the plugin's self-observed health, updated from the listener
+// goroutines as packets arrive and reported once per Gather cycle.
+type stats struct {
+	mu sync.Mutex
+
+	packetsReceived uint64
+	decodeErrors    uint64
+	unmarshalErrors uint64
+	droppedPackets  uint64
+	queueLength     int
+
+	subscriptions map[string]*subscriptionStats
+}
+
+func newStats() *stats {
+	return &stats{subscriptions: make(map[string]*subscriptionStats)}
+}
+
+func (s *stats) recordPacketReceived() {
+	s.mu.Lock()
+	s.packetsReceived++
+	s.mu.Unlock()
+}
+
+func (s *stats) recordDecodeError() {
+	s.mu.Lock()
+	s.decodeErrors++
+	s.mu.Unlock()
+}
+
+func (s *stats) recordUnmarshalError() {
+	s.mu.Lock()
+	s.unmarshalErrors++
+	s.mu.Unlock()
+}
+
+// recordDroppedPacket counts a packet dropped because the decoder queue
+// was full, returning the running total so the caller can log it.
+func (s *stats) recordDroppedPacket() uint64 {
+	s.mu.Lock()
+	s.droppedPackets++
+	n := s.droppedPackets
+	s.mu.Unlock()
+	return n
+}
+
+// recordQueueLength records the decoder queue's depth at the moment of a
+// Gather call, so operators can tell whether decoder_workers needs to be
+// raised alongside the dropped_packets counter.
+func (s *stats) recordQueueLength(n int) {
+	s.mu.Lock()
+	s.queueLength = n
+	s.mu.Unlock()
+}
+
+// recordRows tracks the rows delivered by a single Telemetry message for
+// its node/subscription pair.
+func (s *stats) recordRows(source, subscription string, rows int) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := source + "|" + subscription
+	sub, ok := s.subscriptions[key]
+	if !ok {
+		sub = &subscriptionStats{source: source, subscription: subscription, lastReport: now}
+		s.subscriptions[key] = sub
+	}
+	sub.lastSeen = now
+	sub.rows += uint64(rows)
+}
+
+// report emits the tracked counters as internal metrics and resets the
+// per-subscription row counts so the next report's rows/sec only covers
+// the elapsed interval.
+func (s *stats) report(acc telegraf.Accumulator) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc.AddCounter("huawei_routers_telemetry", map[string]interface{}{
+		"packets_received": s.packetsReceived,
+		"decode_errors":    s.decodeErrors,
+		"unmarshal_errors": s.unmarshalErrors,
+		"dropped_packets":  s.droppedPackets,
+	}, nil, now)
+
+	acc.AddGauge("huawei_routers_telemetry", map[string]interface{}{
+		"queue_length": s.queueLength,
+	}, nil, now)
+
+	for _, sub := range s.subscriptions {
+		elapsed := now.Sub(sub.lastReport).Seconds()
+		var rowsPerSec float64
+		if elapsed > 0 {
+			rowsPerSec = float64(sub.rows) / elapsed
+		}
+
+		tags := map[string]string{
+			"source":       sub.source,
+			"subscription": sub.subscription,
+		}
+		acc.AddGauge("huawei_routers_telemetry_subscription", map[string]interface{}{
+			"last_seen":    sub.lastSeen.Unix(),
+			"rows_per_sec": rowsPerSec,
+		}, tags, now)
+
+		sub.rows = 0
+		sub.lastReport = now
+	}
+}